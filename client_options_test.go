@@ -0,0 +1,61 @@
+package dalle
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewClientAppliesOptions(t *testing.T) {
+	httpClient := &http.Client{}
+
+	c := NewClient("key",
+		WithHTTPClient(httpClient),
+		WithTimeout(5*time.Second),
+		WithBaseURL("https://proxy.example.com/images"),
+		WithUserAgent("go-dalle-test"),
+	).(*client)
+
+	if c.httpClient.Timeout != 5*time.Second {
+		t.Errorf("expected timeout 5s, got %s", c.httpClient.Timeout)
+	}
+
+	if c.baseURL != "https://proxy.example.com/images" {
+		t.Errorf("expected overridden base URL, got %q", c.baseURL)
+	}
+
+	if c.userAgent != "go-dalle-test" {
+		t.Errorf("expected overridden user agent, got %q", c.userAgent)
+	}
+}
+
+// TestWithTimeoutDoesNotMutateCallerHTTPClient guards against WithTimeout
+// setting Timeout on the *http.Client passed to WithHTTPClient in place,
+// which would silently affect a client the caller owns and uses elsewhere.
+func TestWithTimeoutDoesNotMutateCallerHTTPClient(t *testing.T) {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+
+	c := NewClient("key", WithHTTPClient(httpClient), WithTimeout(5*time.Second)).(*client)
+
+	if httpClient.Timeout != 30*time.Second {
+		t.Errorf("expected caller's http.Client to be untouched, got timeout %s", httpClient.Timeout)
+	}
+
+	if c.httpClient.Timeout != 5*time.Second {
+		t.Errorf("expected client's own http.Client to have timeout 5s, got %s", c.httpClient.Timeout)
+	}
+}
+
+func TestWithAzureDeploymentSetsEndpointAndAPIVersion(t *testing.T) {
+	c := NewClient("key", WithAzureDeployment("https://my-resource.openai.azure.com/", "my-deployment", "2024-02-01")).(*client)
+
+	want := "https://my-resource.openai.azure.com/openai/deployments/my-deployment/images"
+	if c.baseURL != want {
+		t.Errorf("expected base URL %q, got %q", want, c.baseURL)
+	}
+
+	wantURL := want + "/generations?api-version=2024-02-01"
+	if got := c.endpointURL("/generations"); got != wantURL {
+		t.Errorf("expected endpoint URL %q, got %q", wantURL, got)
+	}
+}
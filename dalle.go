@@ -2,36 +2,132 @@ package dalle
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	_ "image/png" // registers the PNG decoder image.Decode needs for b64_json/url data
 	"io"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Size is an image dimension accepted by the images API. DALL·E 2 only
+// supports square sizes (Small, Medium, Large); DALL·E 3 supports Large
+// plus the widescreen/portrait sizes Wide and Tall, but not Small or
+// Medium.
+type Size string
+
 // Sizes
 const (
-	Small  int = 256
-	Medium int = 512
-	Large  int = 1024
+	Small  Size = "256x256"
+	Medium Size = "512x512"
+	Large  Size = "1024x1024"
+	Wide   Size = "1792x1024" // dall-e-3 only
+	Tall   Size = "1024x1792" // dall-e-3 only
+)
+
+// Model selects which DALL·E model generates the image. Edit and
+// Variation only ever use DALL·E 2, so Model is only meaningful for
+// Generate/GenerateContext.
+type Model string
+
+const (
+	ModelDALLE2 Model = "dall-e-2"
+	ModelDALLE3 Model = "dall-e-3"
 )
 
+// Quality is a DALL·E 3 only parameter; DALL·E 2 has no quality setting.
+type Quality string
+
+const (
+	QualityStandard Quality = "standard"
+	QualityHD       Quality = "hd"
+)
+
+// Style is a DALL·E 3 only parameter; DALL·E 2 has no style setting.
+type Style string
+
+const (
+	StyleVivid   Style = "vivid"
+	StyleNatural Style = "natural"
+)
+
+var dalle2Sizes = map[Size]bool{Small: true, Medium: true, Large: true}
+var dalle3Sizes = map[Size]bool{Large: true, Wide: true, Tall: true}
+
+// validateGenerateParams rejects model/size/quality/style combinations the
+// images API would otherwise reject server-side with a 400, so callers get
+// a descriptive error without round-tripping to OpenAI first. A nil model
+// is validated as dall-e-2, since that's the documented default when model
+// is omitted.
+func validateGenerateParams(model *Model, size *Size, quality *Quality, style *Style, n *int) error {
+	effectiveModel := ModelDALLE2
+	if model != nil {
+		effectiveModel = *model
+	}
+
+	switch effectiveModel {
+	case ModelDALLE2:
+		if quality != nil {
+			return errors.New("dalle: quality is only supported by dall-e-3")
+		}
+
+		if style != nil {
+			return errors.New("dalle: style is only supported by dall-e-3")
+		}
+
+		if size != nil && !dalle2Sizes[*size] {
+			return fmt.Errorf("dalle: dall-e-2 does not support size %q", *size)
+		}
+	case ModelDALLE3:
+		if n != nil && *n != 1 {
+			return errors.New("dalle: dall-e-3 only supports n=1")
+		}
+
+		if size != nil && !dalle3Sizes[*size] {
+			return fmt.Errorf("dalle: dall-e-3 does not support size %q", *size)
+		}
+	default:
+		return fmt.Errorf("dalle: unsupported model %q", effectiveModel)
+	}
+
+	return nil
+}
+
 const (
 	defaultBaseURL   = "https://api.openai.com/v1/images"
 	defaultUserAgent = "go-dalle"
 	defaultTimeout   = 30 * time.Second
 )
 
+// Retry defaults used by NewClient. maxRetries counts retry attempts after
+// the initial request, so a value of 3 means up to 4 requests are sent.
+const (
+	defaultMaxRetries = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 10 * time.Second
+)
+
 type Response struct {
 	Created int64   `json:"created"`
 	Data    []Datum `json:"data"`
 }
 
+// Datum is a single generated image. Which field is populated depends on
+// the ResponseFormat requested: URLFormat populates URL, Base64JSONFormat
+// populates B64JSON.
 type Datum struct {
-	URL string `json:"url"`
+	URL     string `json:"url,omitempty"`
+	B64JSON string `json:"b64_json,omitempty"`
 }
 
 const (
@@ -40,116 +136,518 @@ const (
 )
 
 type GenerateRequest struct {
-	Prompt         string  `json:"prompt"`
-	N              *int    `json:"n,omitempty"`
-	Size           *string `json:"size,omitempty"`
-	ResponseFormat *string `json:"response_format,omitempty"`
-	User           *string `json:"user,omitempty"`
+	Prompt         string   `json:"prompt"`
+	Model          *Model   `json:"model,omitempty"`
+	N              *int     `json:"n,omitempty"`
+	Size           *Size    `json:"size,omitempty"`
+	Quality        *Quality `json:"quality,omitempty"`
+	Style          *Style   `json:"style,omitempty"`
+	ResponseFormat *string  `json:"response_format,omitempty"`
+	User           *string  `json:"user,omitempty"`
+}
+
+// APIError represents an error response returned by the OpenAI images API.
+// StatusCode is always populated; Type, Code and Param are only populated
+// when OpenAI includes them in the error envelope.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Code       string
+	Param      string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("dalle: %s (status %d, type %s)", e.Message, e.StatusCode, e.Type)
+	}
+
+	return fmt.Sprintf("dalle: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// errorEnvelope mirrors the shape OpenAI wraps API errors in:
+// {"error": {"message", "type", "param", "code"}}.
+type errorEnvelope struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Param   string `json:"param"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// handleErrorResponse turns a non-200 response into an *APIError, falling
+// back to the raw response body if it isn't JSON shaped the way OpenAI
+// documents its errors.
+func handleErrorResponse(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("dalle: reading error response: %w", err)
+	}
+
+	var envelope errorEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error.Message == "" {
+		message := string(body)
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    message,
+		}
+	}
+
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Type:       envelope.Error.Type,
+		Code:       envelope.Error.Code,
+		Param:      envelope.Error.Param,
+		Message:    envelope.Error.Message,
+	}
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// retryDelay computes how long to wait before the next attempt. It honors
+// a Retry-After header (seconds) when present, otherwise falls back to an
+// exponential backoff with jitter so a thundering herd of clients don't
+// retry in lockstep.
+func retryDelay(retryAfter string, base time.Duration, attempt int) time.Duration {
+	if retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	delay := base * time.Duration(1<<uint(attempt))
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2+1)))
+}
+
+// rateLimiter tracks OpenAI's per-minute image request limit from the
+// x-ratelimit-remaining-requests/x-ratelimit-reset-requests response
+// headers, so GenerateBatch can pause submissions before the API starts
+// rejecting them with 429s instead of reacting to 429s after the fact.
+type rateLimiter struct {
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	resetAt   time.Time
+}
+
+// update records the rate limit state from a response. Responses that
+// don't carry the headers (e.g. from a non-OpenAI base URL) leave the
+// limiter's state untouched.
+func (r *rateLimiter) update(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("x-ratelimit-remaining-requests"))
+	if err != nil {
+		return
+	}
+
+	resetIn, err := time.ParseDuration(resp.Header.Get("x-ratelimit-reset-requests"))
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.known = true
+	r.remaining = remaining
+	r.resetAt = time.Now().Add(resetIn)
+}
+
+// wait blocks until the limiter believes a request can be sent, or ctx is
+// done. It's a best-effort gate: with no observed state yet, or quota
+// remaining, it returns immediately.
+func (r *rateLimiter) wait(ctx context.Context) error {
+	r.mu.Lock()
+	known, remaining, resetAt := r.known, r.remaining, r.resetAt
+	r.mu.Unlock()
+
+	if !known || remaining > 0 {
+		return nil
+	}
+
+	delay := time.Until(resetAt)
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
 }
 
 type Client interface {
-	Generate(prompt string, size *int, n *int, user *string, responseType *string) ([]Datum, error)
-	Edit(prompt string, image *os.File, mask *os.File, size *int, n *int, user *string, responseType *string) ([]Datum, error)
-	Variation(image *os.File, size *int, n *int, user *string, responseType *string) ([]Datum, error)
+	Generate(prompt string, model *Model, size *Size, quality *Quality, style *Style, n *int, user *string, responseType *string) ([]Datum, error)
+	GenerateContext(ctx context.Context, prompt string, model *Model, size *Size, quality *Quality, style *Style, n *int, user *string, responseType *string) ([]Datum, error)
+	Edit(prompt string, image io.Reader, imageName string, mask io.Reader, maskName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error)
+	EditContext(ctx context.Context, prompt string, image io.Reader, imageName string, mask io.Reader, maskName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error)
+	Variation(image io.Reader, imageName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error)
+	VariationContext(ctx context.Context, image io.Reader, imageName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error)
+
+	// Download writes datum's image bytes to w: if datum.URL is set, it's
+	// fetched over HTTP; if datum.B64JSON is set, it's base64-decoded
+	// instead. Exactly one of the two is expected to be populated,
+	// matching whichever ResponseFormat was requested.
+	Download(ctx context.Context, datum Datum, w io.Writer) error
+
+	// Save is a convenience wrapper around Download that writes the image
+	// to the file at path, creating or truncating it.
+	Save(ctx context.Context, datum Datum, path string) error
+
+	// Decode downloads/decodes datum the same way Download does, then
+	// decodes the resulting bytes (PNG, as returned by the images API)
+	// into an image.Image.
+	Decode(ctx context.Context, datum Datum) (image.Image, error)
+
+	// GenerateBatch fans prompts out across a worker pool (WithBatchConcurrency,
+	// default defaultBatchConcurrency), applying the same generate options to
+	// each, and gates submissions on OpenAI's per-minute rate limit headers so
+	// many concurrent callers don't trip 429s. The returned slices are aligned
+	// with prompts: results[i]/errs[i] correspond to prompts[i], and exactly
+	// one of them is populated per index.
+	GenerateBatch(ctx context.Context, prompts []string, opts ...GenerateBatchOption) ([][]Datum, []error)
 }
 
 type client struct {
-	baseURL    string
-	apiKey     string
-	userAgent  string
-	httpClient *http.Client
+	baseURL         string
+	apiKey          string
+	userAgent       string
+	organization    string
+	azureAPIVersion string
+	httpClient      *http.Client
+	maxRetries      int
+	retryBaseDelay  time.Duration
+	rateLimiter     *rateLimiter
+}
+
+// ClientOption customizes a Client created by NewClient.
+type ClientOption func(*client)
+
+// WithHTTPClient replaces the http.Client used to make requests, e.g. to
+// inject a mock transport in tests or reuse a client with custom
+// connection pooling. httpClient is used as-is and never mutated by other
+// options, so it's safe to pass one that's shared with or owned by other
+// code.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithBaseURL points the client at a different images API, such as an
+// internal proxy or a mock server in tests, instead of api.openai.com.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithTimeout sets the client's request timeout. It never modifies the
+// http.Client passed to WithHTTPClient in place: it installs a shallow copy
+// with Timeout set, so a caller's own *http.Client is left untouched even
+// if they're also using it elsewhere.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *client) {
+		httpClient := *c.httpClient
+		httpClient.Timeout = timeout
+		c.httpClient = &httpClient
+	}
+}
+
+// WithMaxRetries sets how many times a request is retried after a 429/5xx
+// response before doWithRetry gives up and returns the error (see
+// defaultMaxRetries).
+func WithMaxRetries(maxRetries int) ClientOption {
+	return func(c *client) {
+		c.maxRetries = maxRetries
+	}
+}
+
+// WithRetryBaseDelay sets the base delay used by retryDelay's exponential
+// backoff when a response doesn't carry a Retry-After header (see
+// defaultRetryDelay).
+func WithRetryBaseDelay(retryBaseDelay time.Duration) ClientOption {
+	return func(c *client) {
+		c.retryBaseDelay = retryBaseDelay
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithOrganization sets the OpenAI-Organization header sent with every
+// request, for accounts that belong to more than one organization.
+func WithOrganization(organization string) ClientOption {
+	return func(c *client) {
+		c.organization = organization
+	}
+}
+
+// WithAzureDeployment points the client at an Azure OpenAI deployment
+// instead of api.openai.com. Azure authenticates with an api-key header
+// rather than OpenAI's Authorization: Bearer scheme, and requires an
+// api-version query parameter on every request, so both are handled
+// automatically once this option is set.
+func WithAzureDeployment(resourceURL, deployment, apiVersion string) ClientOption {
+	return func(c *client) {
+		c.baseURL = strings.TrimRight(resourceURL, "/") + "/openai/deployments/" + deployment + "/images"
+		c.azureAPIVersion = apiVersion
+	}
 }
 
-func NewClient(apiKey string) Client {
+func NewClient(apiKey string, opts ...ClientOption) Client {
 	httpClient := &http.Client{
 		Timeout: defaultTimeout,
 	}
 
 	c := &client{
-		baseURL:    defaultBaseURL,
-		apiKey:     apiKey,
-		userAgent:  defaultUserAgent,
-		httpClient: httpClient,
+		baseURL:        defaultBaseURL,
+		apiKey:         apiKey,
+		userAgent:      defaultUserAgent,
+		httpClient:     httpClient,
+		maxRetries:     defaultMaxRetries,
+		retryBaseDelay: defaultRetryDelay,
+		rateLimiter:    &rateLimiter{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
 
 	return c
 }
 
-func pointerizeString(s string) *string {
-	return &s
+// endpointURL builds the URL for an images API path, appending Azure's
+// api-version query parameter when the client is configured for Azure
+// OpenAI.
+func (c *client) endpointURL(path string) string {
+	url := c.baseURL + path
+
+	if c.azureAPIVersion != "" {
+		url += "?api-version=" + c.azureAPIVersion
+	}
+
+	return url
+}
+
+// rewind seeks r back to the start so it can be re-read on a retry. It
+// returns an error if r doesn't support seeking, since its bytes have
+// already been consumed by the previous attempt.
+func rewind(r io.Reader) error {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return errors.New("reader does not support seeking")
+	}
+
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err
+}
+
+// doWithRetry sends the body produced by newBody to url via method,
+// retrying on 429/5xx responses (honoring Retry-After) up to c.maxRetries
+// times. newBody is called again before every attempt, including the
+// first, so callers that stream from a non-rewindable source should fail
+// it on attempt > 0 rather than send a truncated body.
+func (c *client) doWithRetry(ctx context.Context, method, url string, newBody func(attempt int) (io.Reader, string, error)) (*http.Response, error) {
+	var (
+		resp       *http.Response
+		err        error
+		retryAfter string
+	)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			delay := retryDelay(retryAfter, c.retryBaseDelay, attempt-1)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		body, contentType, bodyErr := newBody(attempt)
+		if bodyErr != nil {
+			return nil, bodyErr
+		}
+
+		req, reqErr := http.NewRequestWithContext(ctx, method, url, body)
+		if reqErr != nil {
+			return nil, reqErr
+		}
+
+		if c.azureAPIVersion != "" {
+			req.Header.Set("api-key", c.apiKey)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+
+		req.Header.Set("User-Agent", c.userAgent)
+
+		if c.organization != "" {
+			req.Header.Set("OpenAI-Organization", c.organization)
+		}
+
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err = c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			if attempt >= c.maxRetries {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if attempt >= c.maxRetries || !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		retryAfter = resp.Header.Get("Retry-After")
+		resp.Body.Close()
+	}
+}
+
+// multipartField is an ordered form field; unlike a map it preserves the
+// order fields are written in, matching the wire format the rest of this
+// package has always produced.
+type multipartField struct {
+	name  string
+	value string
+}
+
+// multipartFile is a named file part of a multipart/form-data body.
+type multipartFile struct {
+	field    string
+	filename string
+	reader   io.Reader
+}
+
+// streamMultipart builds a multipart/form-data body without buffering it
+// fully in memory: a background goroutine copies each file and writes each
+// field directly into an io.Pipe as the returned io.Reader is consumed,
+// the way Docker's distribution client streams blob uploads. The returned
+// content type carries the multipart boundary and must be set on the
+// request.
+func streamMultipart(files []multipartFile, fields []multipartField) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+
+	go func() {
+		err := func() error {
+			for _, f := range files {
+				fw, err := w.CreateFormFile(f.field, f.filename)
+				if err != nil {
+					return err
+				}
+
+				if _, err := io.Copy(fw, f.reader); err != nil {
+					return err
+				}
+			}
+
+			for _, field := range fields {
+				if err := w.WriteField(field.name, field.value); err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
+		}()
+
+		pw.CloseWithError(err)
+	}()
+
+	return pr, w.FormDataContentType()
 }
 
 // Prompt is the prompt to generate an image from.
 //
-// Size is the size of the image to generate (Small, Medium, Large).
+// Model selects dall-e-2 or dall-e-3; nil defaults to whatever the API
+// defaults to (currently dall-e-2).
 //
-// N is the number of images to generate.
+// Size is the size of the image to generate (Small, Medium or Large for
+// dall-e-2; Large, Wide or Tall for dall-e-3).
+//
+// Quality and Style are dall-e-3 only parameters.
+//
+// N is the number of images to generate; dall-e-3 only supports n=1.
 //
 // https://beta.openai.com/docs/guides/images/usage
-func (c *client) Generate(prompt string, size *int, n *int, user *string, responseType *string) ([]Datum, error) {
-	url := c.baseURL + "/generations"
-
-	var sizeStr *string
+func (c *client) Generate(prompt string, model *Model, size *Size, quality *Quality, style *Style, n *int, user *string, responseType *string) ([]Datum, error) {
+	return c.GenerateContext(context.Background(), prompt, model, size, quality, style, n, user, responseType)
+}
 
-	if size != nil {
-		sizeStr = pointerizeString(fmt.Sprintf("%dx%d", size, size))
+// GenerateContext is like Generate but carries a context.Context for
+// cancellation and deadlines, which is threaded through to the underlying
+// HTTP request.
+func (c *client) GenerateContext(ctx context.Context, prompt string, model *Model, size *Size, quality *Quality, style *Style, n *int, user *string, responseType *string) ([]Datum, error) {
+	if err := validateGenerateParams(model, size, quality, style, n); err != nil {
+		return nil, err
 	}
 
-	body := GenerateRequest{
+	data, _, err := c.generate(ctx, GenerateRequest{
 		Prompt:         prompt,
+		Model:          model,
 		N:              n,
-		Size:           sizeStr,
+		Size:           size,
+		Quality:        quality,
+		Style:          style,
 		User:           user,
 		ResponseFormat: responseType,
-	}
+	})
 
-	jsonStr, err := json.Marshal(body)
+	return data, err
+}
 
-	if err != nil {
-		return nil, err
-	}
+// generate POSTs body to the generations endpoint and returns the
+// response alongside the decoded data, so callers that care about rate
+// limit headers (GenerateBatch) can inspect resp without a second request.
+// resp is non-nil whenever the request reached the server, even on a
+// non-200 status or a body-decode error.
+func (c *client) generate(ctx context.Context, body GenerateRequest) ([]Datum, *http.Response, error) {
+	url := c.endpointURL("/generations")
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
+	jsonStr, err := json.Marshal(body)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("User-Agent", c.userAgent)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(ctx, "POST", url, func(attempt int) (io.Reader, string, error) {
+		return bytes.NewReader(jsonStr), "application/json", nil
+	})
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		switch resp.StatusCode {
-		case 400:
-			return nil, errors.New("bad request")
-		case 401:
-			return nil, errors.New("unauthorized")
-		case 403:
-			return nil, errors.New("forbidden")
-		case 404:
-			return nil, errors.New("not found")
-		case 429:
-			return nil, errors.New("too many requests")
-		case 500:
-			return nil, errors.New("internal server error")
-		case 502:
-			return nil, errors.New("bad gateway")
-		case 503:
-			return nil, errors.New("service unavailable")
-		case 504:
-			return nil, errors.New("gateway timeout")
-		default:
-			return nil, errors.New("unknown error")
-		}
+		return nil, resp, handleErrorResponse(resp)
 	}
 
 	var response Response
@@ -157,10 +655,10 @@ func (c *client) Generate(prompt string, size *int, n *int, user *string, respon
 	err = json.NewDecoder(resp.Body).Decode(&response)
 
 	if err != nil {
-		return nil, err
+		return nil, resp, err
 	}
 
-	return response.Data, nil
+	return response.Data, resp, nil
 }
 
 // Prompt is the prompt to generate an image from.
@@ -174,11 +672,20 @@ func (c *client) Generate(prompt string, size *int, n *int, user *string, respon
 // N is the number of images to generate.
 //
 // https://beta.openai.com/docs/guides/images/edits
-func (c *client) Edit(prompt string, image *os.File, mask *os.File, size *int, n *int, user *string, responseType *string) ([]Datum, error) {
-	url := c.baseURL + "/edits"
+func (c *client) Edit(prompt string, image io.Reader, imageName string, mask io.Reader, maskName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error) {
+	return c.EditContext(context.Background(), prompt, image, imageName, mask, maskName, size, n, user, responseType)
+}
 
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
+// EditContext is like Edit but carries a context.Context for cancellation
+// and deadlines, which is threaded through to the underlying HTTP request.
+//
+// image and mask are streamed into the request body as they're read, so
+// callers can pass a bytes.Buffer, an *os.File, an HTTP request body, or
+// any other io.Reader without buffering the whole image in memory first.
+// A reader that doesn't implement io.Seeker can't be rewound, so it won't
+// be retried on a 429/5xx response.
+func (c *client) EditContext(ctx context.Context, prompt string, image io.Reader, imageName string, mask io.Reader, maskName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error) {
+	url := c.endpointURL("/edits")
 
 	if image == nil {
 		return nil, errors.New("image is nil")
@@ -188,79 +695,47 @@ func (c *client) Edit(prompt string, image *os.File, mask *os.File, size *int, n
 		return nil, errors.New("mask is nil")
 	}
 
-	if imageWriter, err := w.CreateFormFile("image", image.Name()); err != nil {
-		return nil, err
-	} else if _, err := io.Copy(imageWriter, image); err != nil {
-		return nil, err
-	}
-
-	if maskWriter, err := w.CreateFormFile("mask", mask.Name()); err != nil {
-		return nil, err
-	} else if _, err := io.Copy(maskWriter, mask); err != nil {
-		return nil, err
-	}
-
-	var sizeStr *string
-
-	if size != nil {
-		sizeStr = pointerizeString(fmt.Sprintf("%dx%d", size, size))
+	if size != nil && !dalle2Sizes[*size] {
+		return nil, fmt.Errorf("dalle: edit does not support size %q", *size)
 	}
 
-	err := w.WriteField("prompt", prompt)
-
-	if err != nil {
-		return nil, err
-	}
+	fields := []multipartField{{"prompt", prompt}}
 
 	if n != nil {
-		err = w.WriteField("n", fmt.Sprintf("%d", n))
-
-		if err != nil {
-			return nil, err
-		}
+		fields = append(fields, multipartField{"n", fmt.Sprintf("%d", *n)})
 	}
 
-	if sizeStr != nil {
-		err = w.WriteField("size", *sizeStr)
-
-		if err != nil {
-			return nil, err
-		}
+	if size != nil {
+		fields = append(fields, multipartField{"size", string(*size)})
 	}
 
 	if user != nil {
-		err = w.WriteField("user", *user)
-
-		if err != nil {
-			return nil, err
-		}
+		fields = append(fields, multipartField{"user", *user})
 	}
 
 	if responseType != nil {
-		err = w.WriteField("response_format", *responseType)
-
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	err = w.Close()
-
-	if err != nil {
-		return nil, err
+		fields = append(fields, multipartField{"response_format", *responseType})
 	}
 
-	req, err := http.NewRequest("POST", url, &b)
+	resp, err := c.doWithRetry(ctx, "POST", url, func(attempt int) (io.Reader, string, error) {
+		if attempt > 0 {
+			if err := rewind(image); err != nil {
+				return nil, "", fmt.Errorf("dalle: cannot retry streamed image: %w", err)
+			}
 
-	if err != nil {
-		return nil, err
-	}
+			if err := rewind(mask); err != nil {
+				return nil, "", fmt.Errorf("dalle: cannot retry streamed mask: %w", err)
+			}
+		}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("User-Agent", c.userAgent)
-	req.Header.Set("Content-Type", w.FormDataContentType())
+		files := []multipartFile{
+			{"image", imageName, image},
+			{"mask", maskName, mask},
+		}
 
-	resp, err := c.httpClient.Do(req)
+		body, contentType := streamMultipart(files, fields)
+		return body, contentType, nil
+	})
 
 	if err != nil {
 		return nil, err
@@ -269,28 +744,7 @@ func (c *client) Edit(prompt string, image *os.File, mask *os.File, size *int, n
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		switch resp.StatusCode {
-		case 400:
-			return nil, errors.New("bad request")
-		case 401:
-			return nil, errors.New("unauthorized")
-		case 403:
-			return nil, errors.New("forbidden")
-		case 404:
-			return nil, errors.New("not found")
-		case 429:
-			return nil, errors.New("too many requests")
-		case 500:
-			return nil, errors.New("internal server error")
-		case 502:
-			return nil, errors.New("bad gateway")
-		case 503:
-			return nil, errors.New("service unavailable")
-		case 504:
-			return nil, errors.New("gateway timeout")
-		default:
-			return nil, errors.New("unknown error")
-		}
+		return nil, handleErrorResponse(resp)
 	}
 
 	var response Response
@@ -311,122 +765,275 @@ func (c *client) Edit(prompt string, image *os.File, mask *os.File, size *int, n
 // N is the number of images to generate.
 //
 // https://beta.openai.com/docs/guides/images/variations
-func (c *client) Variation(image *os.File, size *int, n *int, user *string, responseType *string) ([]Datum, error) {
-	url := c.baseURL + "/variations"
+func (c *client) Variation(image io.Reader, imageName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error) {
+	return c.VariationContext(context.Background(), image, imageName, size, n, user, responseType)
+}
 
-	// this is posting using multipart/form-data
+// VariationContext is like Variation but carries a context.Context for
+// cancellation and deadlines, which is threaded through to the underlying
+// HTTP request.
+//
+// image is streamed into the request body as it's read; see EditContext
+// for the retry caveat on non-seekable readers.
+func (c *client) VariationContext(ctx context.Context, image io.Reader, imageName string, size *Size, n *int, user *string, responseType *string) ([]Datum, error) {
+	url := c.endpointURL("/variations")
 
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
+	// this is posting using multipart/form-data
 
 	if image == nil {
 		return nil, errors.New("image is nil")
 	}
 
-	imageWriter, err := w.CreateFormFile("image", image.Name())
-
-	if err != nil {
-		return nil, err
+	if size != nil && !dalle2Sizes[*size] {
+		return nil, fmt.Errorf("dalle: variation does not support size %q", *size)
 	}
 
-	if _, err = io.Copy(imageWriter, image); err != nil {
-		return nil, err
-	}
+	var fields []multipartField
 
-	var sizeStr *string
+	if n != nil {
+		fields = append(fields, multipartField{"n", fmt.Sprintf("%d", *n)})
+	}
 
 	if size != nil {
-		sizeStr = pointerizeString(fmt.Sprintf("%dx%d", size, size))
+		fields = append(fields, multipartField{"size", string(*size)})
 	}
 
-	if n != nil {
-		err = w.WriteField("n", fmt.Sprintf("%d", n))
+	if user != nil {
+		fields = append(fields, multipartField{"user", *user})
+	}
 
-		if err != nil {
-			return nil, err
+	if responseType != nil {
+		fields = append(fields, multipartField{"response_format", *responseType})
+	}
+
+	resp, err := c.doWithRetry(ctx, "POST", url, func(attempt int) (io.Reader, string, error) {
+		if attempt > 0 {
+			if err := rewind(image); err != nil {
+				return nil, "", fmt.Errorf("dalle: cannot retry streamed image: %w", err)
+			}
 		}
+
+		body, contentType := streamMultipart([]multipartFile{{"image", imageName, image}}, fields)
+		return body, contentType, nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	if sizeStr != nil {
-		err = w.WriteField("size", *sizeStr)
+	defer resp.Body.Close()
 
-		if err != nil {
-			return nil, err
-		}
+	if resp.StatusCode != 200 {
+		return nil, handleErrorResponse(resp)
 	}
 
-	if user != nil {
-		err = w.WriteField("user", *user)
+	var response Response
 
-		if err != nil {
-			return nil, err
-		}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+
+	if err != nil {
+		return nil, err
 	}
 
-	if responseType != nil {
-		err = w.WriteField("response_format", *responseType)
+	return response.Data, nil
+}
 
+// Download writes datum's image bytes to w. If datum.B64JSON is set, it's
+// base64-decoded directly; otherwise datum.URL is fetched with the
+// client's http.Client.
+func (c *client) Download(ctx context.Context, datum Datum, w io.Writer) error {
+	if datum.B64JSON != "" {
+		data, err := base64.StdEncoding.DecodeString(datum.B64JSON)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("dalle: decoding b64_json: %w", err)
 		}
+
+		_, err = w.Write(data)
+		return err
 	}
 
-	err = w.Close()
+	if datum.URL == "" {
+		return errors.New("dalle: datum has neither url nor b64_json set")
+	}
 
+	req, err := http.NewRequestWithContext(ctx, "GET", datum.URL, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req, err := http.NewRequest("POST", url, &b)
-
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("User-Agent", c.userAgent)
-	req.Header.Set("Content-Type", w.FormDataContentType())
+	defer resp.Body.Close()
 
-	resp, err := c.httpClient.Do(req)
+	if resp.StatusCode != 200 {
+		return handleErrorResponse(resp)
+	}
 
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Save is a convenience wrapper around Download that writes the image to
+// the file at path, creating or truncating it.
+func (c *client) Save(ctx context.Context, datum Datum, path string) error {
+	f, err := os.Create(path)
 	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.Download(ctx, datum, f)
+}
+
+// Decode downloads/decodes datum the same way Download does, then decodes
+// the resulting bytes (PNG, as returned by the images API) into an
+// image.Image.
+func (c *client) Decode(ctx context.Context, datum Datum) (image.Image, error) {
+	var buf bytes.Buffer
+
+	if err := c.Download(ctx, datum, &buf); err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
+	img, _, err := image.Decode(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("dalle: decoding image: %w", err)
+	}
 
-	if resp.StatusCode != 200 {
-		switch resp.StatusCode {
-		case 400:
-			return nil, errors.New("bad request")
-		case 401:
-			return nil, errors.New("unauthorized")
-		case 403:
-			return nil, errors.New("forbidden")
-		case 404:
-			return nil, errors.New("not found")
-		case 429:
-			return nil, errors.New("too many requests")
-		case 500:
-			return nil, errors.New("internal server error")
-		case 502:
-			return nil, errors.New("bad gateway")
-		case 503:
-			return nil, errors.New("service unavailable")
-		case 504:
-			return nil, errors.New("gateway timeout")
-		default:
-			return nil, errors.New("unknown error")
-		}
+	return img, nil
+}
+
+const defaultBatchConcurrency = 4
+
+// generateBatchConfig holds the options a GenerateBatch call applies to
+// every prompt in the batch.
+type generateBatchConfig struct {
+	concurrency    int
+	model          *Model
+	size           *Size
+	quality        *Quality
+	style          *Style
+	user           *string
+	responseFormat *string
+}
+
+// GenerateBatchOption customizes a GenerateBatch call.
+type GenerateBatchOption func(*generateBatchConfig)
+
+// WithBatchConcurrency caps how many generate requests are in flight at
+// once. It defaults to defaultBatchConcurrency.
+func WithBatchConcurrency(n int) GenerateBatchOption {
+	return func(cfg *generateBatchConfig) {
+		cfg.concurrency = n
 	}
+}
 
-	var response Response
+// WithBatchModel applies model to every prompt in the batch.
+func WithBatchModel(model Model) GenerateBatchOption {
+	return func(cfg *generateBatchConfig) {
+		cfg.model = &model
+	}
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&response)
+// WithBatchSize applies size to every prompt in the batch.
+func WithBatchSize(size Size) GenerateBatchOption {
+	return func(cfg *generateBatchConfig) {
+		cfg.size = &size
+	}
+}
 
-	if err != nil {
-		return nil, err
+// WithBatchQuality applies quality to every prompt in the batch.
+func WithBatchQuality(quality Quality) GenerateBatchOption {
+	return func(cfg *generateBatchConfig) {
+		cfg.quality = &quality
 	}
+}
 
-	return response.Data, nil
+// WithBatchStyle applies style to every prompt in the batch.
+func WithBatchStyle(style Style) GenerateBatchOption {
+	return func(cfg *generateBatchConfig) {
+		cfg.style = &style
+	}
+}
+
+// WithBatchUser applies user to every prompt in the batch.
+func WithBatchUser(user string) GenerateBatchOption {
+	return func(cfg *generateBatchConfig) {
+		cfg.user = &user
+	}
+}
+
+// WithBatchResponseFormat applies responseFormat to every prompt in the
+// batch.
+func WithBatchResponseFormat(responseFormat string) GenerateBatchOption {
+	return func(cfg *generateBatchConfig) {
+		cfg.responseFormat = &responseFormat
+	}
+}
+
+// GenerateBatch fans prompts out across a worker pool, applying the same
+// generate options to each, and gates submissions on OpenAI's per-minute
+// rate limit headers so many concurrent callers don't trip 429s.
+func (c *client) GenerateBatch(ctx context.Context, prompts []string, opts ...GenerateBatchOption) ([][]Datum, []error) {
+	cfg := generateBatchConfig{concurrency: defaultBatchConcurrency}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.concurrency < 1 {
+		cfg.concurrency = 1
+	}
+
+	results := make([][]Datum, len(prompts))
+	errs := make([]error, len(prompts))
+
+	if err := validateGenerateParams(cfg.model, cfg.size, cfg.quality, cfg.style, nil); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return results, errs
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.concurrency)
+
+	for i, prompt := range prompts {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, prompt string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := c.rateLimiter.wait(ctx); err != nil {
+				errs[i] = err
+				return
+			}
+
+			data, resp, err := c.generate(ctx, GenerateRequest{
+				Prompt:         prompt,
+				Model:          cfg.model,
+				Size:           cfg.size,
+				Quality:        cfg.quality,
+				Style:          cfg.style,
+				User:           cfg.user,
+				ResponseFormat: cfg.responseFormat,
+			})
+
+			if resp != nil {
+				c.rateLimiter.update(resp)
+			}
+
+			results[i], errs[i] = data, err
+		}(i, prompt)
+	}
+
+	wg.Wait()
+
+	return results, errs
 }
@@ -19,7 +19,7 @@ func TestGenerate(t *testing.T) {
 	apiKey := os.Getenv("DALLE_API_KEY")
 	client := dalle.NewClient(apiKey)
 
-	data, err := client.Generate("A horse in an elevator", nil, nil, nil, nil)
+	data, err := client.Generate("A horse in an elevator", nil, nil, nil, nil, nil, nil, nil)
 
 	if err != nil {
 		t.Error(err)
@@ -56,7 +56,7 @@ func TestEdit(t *testing.T) {
 		t.FailNow()
 	}
 
-	data, err := client.Edit("a sunlit indoor lounge area with a pool containing a flamingo", file, mask, nil, nil, nil, nil)
+	data, err := client.Edit("a sunlit indoor lounge area with a pool containing a flamingo", file, "image_edit_original.png", mask, "image_edit_mask.png", nil, nil, nil, nil)
 
 	if err != nil {
 		t.Error(err)
@@ -86,7 +86,7 @@ func TestVariation(t *testing.T) {
 		t.FailNow()
 	}
 
-	data, err := client.Variation(file, nil, nil, nil, nil)
+	data, err := client.Variation(file, "image_edit_original.png", nil, nil, nil, nil)
 
 	if err != nil {
 		t.Error(err)
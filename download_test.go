@@ -0,0 +1,86 @@
+package dalle
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func pngBytes(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.White)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding test PNG: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDownloadFromURL(t *testing.T) {
+	want := pngBytes(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(want)
+	}))
+	defer server.Close()
+
+	c := NewClient("key")
+
+	var buf bytes.Buffer
+	if err := c.Download(context.Background(), Datum{URL: server.URL}, &buf); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("downloaded bytes did not match served bytes")
+	}
+}
+
+func TestDownloadFromB64JSON(t *testing.T) {
+	want := pngBytes(t)
+	c := NewClient("key")
+
+	var buf bytes.Buffer
+	datum := Datum{B64JSON: base64.StdEncoding.EncodeToString(want)}
+	if err := c.Download(context.Background(), datum, &buf); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("decoded bytes did not match original bytes")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	want := pngBytes(t)
+	c := NewClient("key")
+
+	datum := Datum{B64JSON: base64.StdEncoding.EncodeToString(want)}
+	img, err := c.Decode(context.Background(), datum)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if img.Bounds().Dx() != 2 || img.Bounds().Dy() != 2 {
+		t.Errorf("expected a 2x2 image, got bounds %v", img.Bounds())
+	}
+}
+
+func TestDownloadRequiresURLOrB64JSON(t *testing.T) {
+	c := NewClient("key")
+
+	var buf bytes.Buffer
+	if err := c.Download(context.Background(), Datum{}, &buf); err == nil {
+		t.Error("expected an error for an empty Datum")
+	}
+}
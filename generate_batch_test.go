@@ -0,0 +1,84 @@
+package dalle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenerateBatchFansOutAndAligns(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("x-ratelimit-remaining-requests", "50")
+		w.Header().Set("x-ratelimit-reset-requests", "6m0s")
+		w.Write([]byte(`{"created":1,"data":[{"url":"https://example.com/image.png"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewClient("key", WithBaseURL(server.URL))
+
+	prompts := []string{"a cat", "a dog", "a horse"}
+	results, errs := c.GenerateBatch(context.Background(), prompts, WithBatchConcurrency(2))
+
+	if int(requests) != len(prompts) {
+		t.Errorf("expected %d requests, got %d", len(prompts), requests)
+	}
+
+	for i := range prompts {
+		if errs[i] != nil {
+			t.Errorf("prompt %d: unexpected error: %v", i, errs[i])
+		}
+
+		if len(results[i]) != 1 || results[i][0].URL != "https://example.com/image.png" {
+			t.Errorf("prompt %d: unexpected result: %+v", i, results[i])
+		}
+	}
+}
+
+func TestGenerateBatchRejectsInvalidOptionsUpFront(t *testing.T) {
+	c := NewClient("key")
+
+	_, errs := c.GenerateBatch(context.Background(), []string{"a", "b"}, WithBatchModel(ModelDALLE3), WithBatchSize(Small))
+
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("prompt %d: expected a validation error, got nil", i)
+		}
+	}
+}
+
+func TestRateLimiterWaitsUntilReset(t *testing.T) {
+	r := &rateLimiter{}
+
+	if err := r.wait(context.Background()); err != nil {
+		t.Fatalf("wait with no known state should return immediately: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("x-ratelimit-remaining-requests", "0")
+		w.Header().Set("x-ratelimit-reset-requests", "10ms")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	r.update(resp)
+
+	if err := r.wait(context.Background()); err != nil {
+		t.Fatalf("wait should return once the reset delay elapses: %v", err)
+	}
+
+	if time.Now().Before(r.resetAt) {
+		t.Error("wait returned before the limiter's reset time")
+	}
+}
@@ -0,0 +1,46 @@
+package dalle
+
+import "testing"
+
+func TestValidateGenerateParams(t *testing.T) {
+	dalle2 := ModelDALLE2
+	dalle3 := ModelDALLE3
+	hd := QualityHD
+	vivid := StyleVivid
+	wide := Wide
+	small := Small
+	two := 2
+
+	cases := []struct {
+		name    string
+		model   *Model
+		size    *Size
+		quality *Quality
+		style   *Style
+		n       *int
+		wantErr bool
+	}{
+		{name: "no model defaults to dall-e-2 and rejects wide size", model: nil, size: &wide, n: &two, wantErr: true},
+		{name: "no model defaults to dall-e-2 and accepts its default size", model: nil, size: &small, wantErr: false},
+		{name: "dall-e-2 default size", model: &dalle2, size: &small, wantErr: false},
+		{name: "dall-e-2 rejects wide size", model: &dalle2, size: &wide, wantErr: true},
+		{name: "dall-e-2 rejects quality", model: &dalle2, quality: &hd, wantErr: true},
+		{name: "dall-e-2 rejects style", model: &dalle2, style: &vivid, wantErr: true},
+		{name: "dall-e-3 accepts wide size", model: &dalle3, size: &wide, wantErr: false},
+		{name: "dall-e-3 rejects small size", model: &dalle3, size: &small, wantErr: true},
+		{name: "dall-e-3 rejects n>1", model: &dalle3, n: &two, wantErr: true},
+		{name: "unsupported model", model: func() *Model { m := Model("dall-e-4"); return &m }(), wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateGenerateParams(tc.model, tc.size, tc.quality, tc.style, tc.n)
+			if tc.wantErr && err == nil {
+				t.Error("expected an error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
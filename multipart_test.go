@@ -0,0 +1,134 @@
+package dalle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamMultipartWritesFilesAndFields(t *testing.T) {
+	image := strings.NewReader("image-bytes")
+	mask := strings.NewReader("mask-bytes")
+
+	body, contentType := streamMultipart(
+		[]multipartFile{
+			{"image", "image.png", image},
+			{"mask", "mask.png", mask},
+		},
+		[]multipartField{
+			{"prompt", "a cat"},
+			{"n", "2"},
+		},
+	)
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("parsing content type: %v", err)
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+
+	var gotImage, gotMask, gotPrompt, gotN string
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, part); err != nil {
+			t.Fatalf("copying part: %v", err)
+		}
+
+		switch part.FormName() {
+		case "image":
+			gotImage = buf.String()
+		case "mask":
+			gotMask = buf.String()
+		case "prompt":
+			gotPrompt = buf.String()
+		case "n":
+			gotN = buf.String()
+		}
+	}
+
+	if gotImage != "image-bytes" || gotMask != "mask-bytes" {
+		t.Errorf("image/mask not streamed correctly: image=%q mask=%q", gotImage, gotMask)
+	}
+
+	if gotPrompt != "a cat" || gotN != "2" {
+		t.Errorf("fields not streamed correctly: prompt=%q n=%q", gotPrompt, gotN)
+	}
+}
+
+// formFieldFromRequest parses r as a multipart/form-data request and
+// returns the value of the named field.
+func formFieldFromRequest(t *testing.T, r *http.Request, name string) string {
+	t.Helper()
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatalf("parsing multipart form: %v", err)
+	}
+
+	return r.FormValue(name)
+}
+
+// TestEditContextSendsRequestedN guards against formatting n (an *int) with
+// its pointer value instead of the int it points to: streamMultipart alone
+// can't catch this, since it's handed an already-stringified field, so this
+// drives the real *int through EditContext end-to-end.
+func TestEditContextSendsRequestedN(t *testing.T) {
+	var gotN string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotN = formFieldFromRequest(t, r, "n")
+		w.Write([]byte(`{"created":1,"data":[{"url":"https://example.com/image.png"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewClient("key", WithBaseURL(server.URL))
+
+	n := 3
+	_, err := c.EditContext(context.Background(), "a cat", strings.NewReader("image"), "image.png", strings.NewReader("mask"), "mask.png", nil, &n, nil, nil)
+	if err != nil {
+		t.Fatalf("EditContext: %v", err)
+	}
+
+	if gotN != "3" {
+		t.Errorf("expected n=%q, got %q", "3", gotN)
+	}
+}
+
+// TestVariationContextSendsRequestedN is the Variation counterpart to
+// TestEditContextSendsRequestedN.
+func TestVariationContextSendsRequestedN(t *testing.T) {
+	var gotN string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotN = formFieldFromRequest(t, r, "n")
+		w.Write([]byte(`{"created":1,"data":[{"url":"https://example.com/image.png"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewClient("key", WithBaseURL(server.URL))
+
+	n := 4
+	_, err := c.VariationContext(context.Background(), strings.NewReader("image"), "image.png", nil, &n, nil, nil)
+	if err != nil {
+		t.Fatalf("VariationContext: %v", err)
+	}
+
+	if gotN != "4" {
+		t.Errorf("expected n=%q, got %q", "4", gotN)
+	}
+}
@@ -0,0 +1,95 @@
+package dalle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoWithRetryRetriesOn429ThenSucceeds(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.Write([]byte(`{"created":1,"data":[{"url":"https://example.com/image.png"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewClient("key", WithBaseURL(server.URL), WithRetryBaseDelay(time.Millisecond))
+
+	if _, err := c.GenerateContext(context.Background(), "a cat", nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("GenerateContext: %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests (1 retry), got %d", requests)
+	}
+}
+
+func TestDoWithRetryHonorsRetryAfterHeader(t *testing.T) {
+	var requests int32
+	start := time.Now()
+	var retriedAt time.Time
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		retriedAt = time.Now()
+		w.Write([]byte(`{"created":1,"data":[{"url":"https://example.com/image.png"}]}`))
+	}))
+	defer server.Close()
+
+	// A long base delay proves the 1s Retry-After wins over backoff, not the other way around.
+	c := NewClient("key", WithBaseURL(server.URL), WithRetryBaseDelay(time.Hour))
+
+	if _, err := c.GenerateContext(context.Background(), "a cat", nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("GenerateContext: %v", err)
+	}
+
+	if requests != 2 {
+		t.Fatalf("expected 2 requests (1 retry), got %d", requests)
+	}
+
+	if elapsed := retriedAt.Sub(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("expected the retry to wait ~1s per Retry-After, took %s", elapsed)
+	}
+}
+
+func TestDoWithRetryReturnsAPIErrorAfterExhaustingRetries(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"message":"upstream failure","type":"server_error"}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient("key", WithBaseURL(server.URL), WithMaxRetries(2), WithRetryBaseDelay(time.Millisecond))
+
+	_, err := c.GenerateContext(context.Background(), "a cat", nil, nil, nil, nil, nil, nil, nil)
+
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+
+	if apiErr.StatusCode != http.StatusInternalServerError || apiErr.Message != "upstream failure" {
+		t.Errorf("unexpected APIError: %+v", apiErr)
+	}
+
+	if requests != 3 {
+		t.Errorf("expected 3 requests (initial + 2 retries), got %d", requests)
+	}
+}